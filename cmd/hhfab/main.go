@@ -0,0 +1,30 @@
+// Copyright 2024 Hedgehog
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+func main() {
+	app := &cli.App{
+		Name:  "hhfab",
+		Usage: "drive VLAB test scenarios against a fabricator installation",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "workdir", Usage: "VLAB working directory", Value: "."},
+			&cli.StringFlag{Name: "cachedir", Usage: "VLAB cache directory", Value: "/tmp/hhfab-cache"},
+		},
+		Commands: []*cli.Command{
+			testCmd(),
+		},
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
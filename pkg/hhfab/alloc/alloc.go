@@ -0,0 +1,285 @@
+// Copyright 2024 Hedgehog
+// SPDX-License-Identifier: Apache-2.0
+
+// Package alloc hands out non-overlapping subnet/VLAN/VNI allocations for
+// VPC test scenarios, so anything more elaborate than a uniform layout
+// (large mesh topologies, mixed subnet sizes) doesn't require manual
+// bookkeeping against the IPv4/VLAN namespaces.
+package alloc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+)
+
+// Subnet is one allocation handed out by an Allocator.
+type Subnet struct {
+	Name string `json:"name"`
+	CIDR string `json:"cidr"`
+	VLAN int    `json:"vlan"`
+	VNI  int    `json:"vni"`
+}
+
+// Pools describes the ranges an Allocator draws from.
+type Pools struct {
+	// CIDR is the base pool subnets are carved out of, e.g. "10.0.0.0/16".
+	CIDR string `json:"cidr"`
+	// SubnetPrefixLen is the prefix length of each allocated subnet, e.g. 24
+	// for a pool of /24s.
+	SubnetPrefixLen int `json:"subnetPrefixLen"`
+	// VLANMin/VLANMax and VNIMin/VNIMax are inclusive ranges.
+	VLANMin int `json:"vlanMin"`
+	VLANMax int `json:"vlanMax"`
+	VNIMin  int `json:"vniMin"`
+	VNIMax  int `json:"vniMax"`
+}
+
+// Allocator hands out non-overlapping Subnet records from a Pools
+// configuration, tracks releases, and can be serialized so re-runs against
+// the same workDir are reproducible.
+type Allocator struct {
+	mu sync.Mutex
+
+	pools     Pools
+	base      *net.IPNet
+	nextVLAN  int
+	nextVNI   int
+	usedVLANs map[int]bool
+	usedVNIs  map[int]bool
+	usedNets  map[string]bool
+	allocated map[string]Subnet
+	order     []string
+}
+
+// New creates an Allocator from the given pools.
+func New(pools Pools) (*Allocator, error) {
+	_, base, err := net.ParseCIDR(pools.CIDR)
+	if err != nil {
+		return nil, fmt.Errorf("parsing pool CIDR %q: %w", pools.CIDR, err)
+	}
+	if base.IP.To4() == nil {
+		return nil, fmt.Errorf("pool CIDR %q must be IPv4, got an IPv6 prefix", pools.CIDR)
+	}
+
+	baseLen, _ := base.Mask.Size()
+	if pools.SubnetPrefixLen < baseLen {
+		return nil, fmt.Errorf("subnet prefix /%d must be more specific than pool /%d", pools.SubnetPrefixLen, baseLen)
+	}
+	if pools.VLANMax < pools.VLANMin {
+		return nil, fmt.Errorf("vlan range %d..%d is backwards", pools.VLANMin, pools.VLANMax)
+	}
+	if pools.VNIMax < pools.VNIMin {
+		return nil, fmt.Errorf("vni range %d..%d is backwards", pools.VNIMin, pools.VNIMax)
+	}
+
+	return &Allocator{
+		pools:     pools,
+		base:      base,
+		nextVLAN:  pools.VLANMin,
+		nextVNI:   pools.VNIMin,
+		usedVLANs: map[int]bool{},
+		usedVNIs:  map[int]bool{},
+		usedNets:  map[string]bool{},
+		allocated: map[string]Subnet{},
+	}, nil
+}
+
+// Allocate hands out the next free subnet/VLAN/VNI for name. Calling
+// Allocate again for a name that's already allocated returns the existing
+// Subnet unchanged.
+func (a *Allocator) Allocate(name string) (Subnet, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if s, ok := a.allocated[name]; ok {
+		return s, nil
+	}
+
+	cidr, err := a.nextCIDR()
+	if err != nil {
+		return Subnet{}, err
+	}
+
+	vlan, err := a.nextFree(a.nextVLAN, a.pools.VLANMax, a.usedVLANs)
+	if err != nil {
+		return Subnet{}, fmt.Errorf("allocating vlan for %q: %w", name, err)
+	}
+
+	vni, err := a.nextFree(a.nextVNI, a.pools.VNIMax, a.usedVNIs)
+	if err != nil {
+		return Subnet{}, fmt.Errorf("allocating vni for %q: %w", name, err)
+	}
+
+	a.usedVLANs[vlan] = true
+	a.usedVNIs[vni] = true
+	a.nextVLAN = vlan + 1
+	a.nextVNI = vni + 1
+
+	s := Subnet{Name: name, CIDR: cidr, VLAN: vlan, VNI: vni}
+	a.allocated[name] = s
+	a.order = append(a.order, name)
+
+	return s, nil
+}
+
+// Release frees the VLAN and VNI held by name so they can be reused, and
+// forgets the subnet's CIDR. It's a no-op if name was never allocated.
+func (a *Allocator) Release(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s, ok := a.allocated[name]
+	if !ok {
+		return
+	}
+
+	delete(a.usedVLANs, s.VLAN)
+	delete(a.usedVNIs, s.VNI)
+	delete(a.usedNets, s.CIDR)
+	delete(a.allocated, name)
+
+	// Rewind the cursors so a released VLAN/VNI is handed out again instead
+	// of Allocate scanning past it forever.
+	if s.VLAN < a.nextVLAN {
+		a.nextVLAN = s.VLAN
+	}
+	if s.VNI < a.nextVNI {
+		a.nextVNI = s.VNI
+	}
+
+	for i, n := range a.order {
+		if n == name {
+			a.order = append(a.order[:i], a.order[i+1:]...)
+
+			break
+		}
+	}
+}
+
+// PrintPlan writes the current allocations to w as a human-reviewable
+// table, in allocation order, so a reviewer can sanity-check a large mesh
+// topology before it's applied.
+func (a *Allocator) PrintPlan(w io.Writer) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := fmt.Fprintf(w, "%-24s %-18s %6s %8s\n", "NAME", "CIDR", "VLAN", "VNI"); err != nil {
+		return err
+	}
+
+	for _, name := range a.order {
+		s := a.allocated[name]
+		if _, err := fmt.Fprintf(w, "%-24s %-18s %6d %8d\n", s.Name, s.CIDR, s.VLAN, s.VNI); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Save serializes the allocator's pools and current allocations to path.
+func (a *Allocator) Save(path string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	subnets := make([]Subnet, 0, len(a.order))
+	for _, name := range a.order {
+		subnets = append(subnets, a.allocated[name])
+	}
+
+	data, err := json.MarshalIndent(state{Pools: a.pools, Subnets: subnets}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling allocator state: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("writing allocator state to %q: %w", path, err)
+	}
+
+	return nil
+}
+
+// Load restores an Allocator previously written by Save, so re-running the
+// same scenario against the same workDir reuses the same allocations.
+func Load(path string) (*Allocator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading allocator state from %q: %w", path, err)
+	}
+
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("unmarshaling allocator state: %w", err)
+	}
+
+	a, err := New(st.Pools)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range st.Subnets {
+		a.allocated[s.Name] = s
+		a.order = append(a.order, s.Name)
+		a.usedVLANs[s.VLAN] = true
+		a.usedVNIs[s.VNI] = true
+		a.usedNets[s.CIDR] = true
+		if s.VLAN >= a.nextVLAN {
+			a.nextVLAN = s.VLAN + 1
+		}
+		if s.VNI >= a.nextVNI {
+			a.nextVNI = s.VNI + 1
+		}
+	}
+
+	return a, nil
+}
+
+type state struct {
+	Pools   Pools    `json:"pools"`
+	Subnets []Subnet `json:"subnets"`
+}
+
+func (a *Allocator) nextCIDR() (string, error) {
+	ones, bits := a.base.Mask.Size()
+	count := 1 << uint(a.pools.SubnetPrefixLen-ones)
+
+	for i := 0; i < count; i++ {
+		candidate := nthSubnet(a.base, a.pools.SubnetPrefixLen, i)
+		if a.usedNets[candidate] {
+			continue
+		}
+
+		a.usedNets[candidate] = true
+
+		return candidate, nil
+	}
+
+	return "", fmt.Errorf("no free /%d subnets left in pool %s (bits=%d)", a.pools.SubnetPrefixLen, a.pools.CIDR, bits)
+}
+
+func nthSubnet(base *net.IPNet, prefixLen, n int) string {
+	ip := append(net.IP(nil), base.IP.To4()...)
+	shift := 32 - prefixLen
+	value := uint32(n) << uint(shift)
+
+	ip[0] |= byte(value >> 24)
+	ip[1] |= byte(value >> 16)
+	ip[2] |= byte(value >> 8)
+	ip[3] |= byte(value)
+
+	return fmt.Sprintf("%s/%d", ip.String(), prefixLen)
+}
+
+func (a *Allocator) nextFree(start, max int, used map[int]bool) (int, error) {
+	for i := start; i <= max; i++ {
+		if !used[i] {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("exhausted range, max=%d", max)
+}
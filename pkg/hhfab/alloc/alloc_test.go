@@ -0,0 +1,123 @@
+// Copyright 2024 Hedgehog
+// SPDX-License-Identifier: Apache-2.0
+
+package alloc
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPools() Pools {
+	return Pools{
+		CIDR:            "10.0.0.0/16",
+		SubnetPrefixLen: 24,
+		VLANMin:         1000,
+		VLANMax:         1010,
+		VNIMin:          5000,
+		VNIMax:          5010,
+	}
+}
+
+func TestAllocateIsDeterministicAndNonOverlapping(t *testing.T) {
+	a, err := New(testPools())
+	require.NoError(t, err)
+
+	s1, err := a.Allocate("vpc-01")
+	require.NoError(t, err)
+	s2, err := a.Allocate("vpc-02")
+	require.NoError(t, err)
+
+	assert.Equal(t, "10.0.0.0/24", s1.CIDR)
+	assert.Equal(t, "10.0.1.0/24", s2.CIDR)
+	assert.NotEqual(t, s1.VLAN, s2.VLAN)
+	assert.NotEqual(t, s1.VNI, s2.VNI)
+
+	// Allocating the same name again is idempotent.
+	again, err := a.Allocate("vpc-01")
+	require.NoError(t, err)
+	assert.Equal(t, s1, again)
+}
+
+func TestReleaseFreesVLANAndVNI(t *testing.T) {
+	a, err := New(testPools())
+	require.NoError(t, err)
+
+	s1, err := a.Allocate("vpc-01")
+	require.NoError(t, err)
+	a.Release("vpc-01")
+
+	s2, err := a.Allocate("vpc-02")
+	require.NoError(t, err)
+	assert.Equal(t, s1.VLAN, s2.VLAN)
+	assert.Equal(t, s1.VNI, s2.VNI)
+}
+
+func TestExhaustedVLANRange(t *testing.T) {
+	pools := testPools()
+	pools.VLANMin, pools.VLANMax = 1000, 1000
+	a, err := New(pools)
+	require.NoError(t, err)
+
+	_, err = a.Allocate("vpc-01")
+	require.NoError(t, err)
+	_, err = a.Allocate("vpc-02")
+	assert.Error(t, err)
+}
+
+func TestPrintPlan(t *testing.T) {
+	a, err := New(testPools())
+	require.NoError(t, err)
+	_, err = a.Allocate("vpc-01")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, a.PrintPlan(&buf))
+	assert.Contains(t, buf.String(), "vpc-01")
+	assert.Contains(t, buf.String(), "10.0.0.0/24")
+}
+
+func TestSaveAndLoadRoundTrip(t *testing.T) {
+	a, err := New(testPools())
+	require.NoError(t, err)
+	_, err = a.Allocate("vpc-01")
+	require.NoError(t, err)
+	_, err = a.Allocate("vpc-02")
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "alloc.json")
+	require.NoError(t, a.Save(path))
+
+	loaded, err := Load(path)
+	require.NoError(t, err)
+
+	// The next allocation must not collide with anything restored from disk.
+	s3, err := loaded.Allocate("vpc-03")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.2.0/24", s3.CIDR)
+
+	s1, err := loaded.Allocate("vpc-01")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/24", s1.CIDR)
+}
+
+func TestNewValidatesPools(t *testing.T) {
+	pools := testPools()
+	pools.SubnetPrefixLen = 8
+	_, err := New(pools)
+	assert.Error(t, err)
+
+	pools = testPools()
+	pools.VLANMax = pools.VLANMin - 1
+	_, err = New(pools)
+	assert.Error(t, err)
+
+	pools = testPools()
+	pools.CIDR = "2001:db8::/32"
+	_, err = New(pools)
+	assert.Error(t, err)
+}
@@ -0,0 +1,200 @@
+// Copyright 2024 Hedgehog
+// SPDX-License-Identifier: Apache-2.0
+
+package hhfab
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	vpcapi "go.githedgehog.com/fabric/api/vpc/v1beta1"
+	"go.githedgehog.com/fabricator/pkg/hhfab/report"
+)
+
+// DoVLABTestConnectivityWithReporter runs DoVLABTestConnectivity once and
+// reports one report.Record per (srcServer, dstServer) pair implied by
+// vpcPeerings and extPeerings, instead of just the aggregate error
+// DoVLABTestConnectivity itself returns.
+//
+// DoVLABTestConnectivity doesn't expose per-pair results, so every record
+// from a permitted pair shares the one run's pass/fail outcome and latency
+// - this is an honest proxy, not independently measured per pair. What is
+// real per record: which server pairs are expected to reach each other at
+// all, derived from the actual permit data instead of a hard-coded true.
+// vpcNames is the full set of VPC names in the topology (not just the
+// peered ones) so pairs that were deliberately left unpeered show up as
+// ExpectedReachable: false records instead of being silently absent.
+//
+// Per-server names are synthesized as "<vpc>-s<subnet>-server-<n>" from
+// subnetsPerVPC/serversPerSubnet, matching the convention VLAB itself uses
+// to name servers within a VPC's subnets.
+func DoVLABTestConnectivityWithReporter(
+	ctx context.Context,
+	workDir, cacheDir string,
+	opts TestConnectivityOpts,
+	vpcNames []string,
+	subnetsPerVPC, serversPerSubnet int,
+	vpcPeerings map[string]*vpcapi.VPCPeeringSpec,
+	extPeerings map[string]*vpcapi.ExternalPeeringSpec,
+	reporter report.Reporter,
+) error {
+	tuples := connTuples(vpcNames, subnetsPerVPC, serversPerSubnet, vpcPeerings, extPeerings)
+
+	start := time.Now()
+	runErr := DoVLABTestConnectivity(ctx, workDir, cacheDir, opts)
+	latencyMs := float64(time.Since(start).Microseconds()) / 1000
+
+	matrix := make(report.Matrix, 0, len(tuples))
+	for _, t := range tuples {
+		rec := report.Record{
+			Src:               t.src,
+			Dst:               t.dst,
+			ExpectedReachable: t.expectedReachable,
+		}
+
+		if t.expectedReachable {
+			// The only real signal available is the single run's aggregate
+			// outcome - attribute it to every permitted pair rather than
+			// claim a per-pair result we don't have.
+			rec.Actual = runErr == nil
+			rec.LatencyMs = latencyMs
+			if runErr != nil {
+				rec.Error = runErr.Error()
+			}
+		} else {
+			// Pairs with no permit entry at all are unreachable by
+			// construction - that doesn't depend on the test run's outcome.
+			rec.Actual = false
+		}
+
+		matrix = append(matrix, rec)
+	}
+
+	if reporter != nil {
+		if err := reporter.Report(matrix); err != nil {
+			return fmt.Errorf("reporting connectivity matrix: %w", err)
+		}
+	}
+
+	return runErr
+}
+
+// connTuple is one (srcServer, dstServer) pair implied by the topology,
+// plus whether it's expected to be reachable at all.
+type connTuple struct {
+	src, dst          string
+	expectedReachable bool
+}
+
+// connTuples expands vpcPeerings and extPeerings into per-server pairs for
+// every permitted combination, then adds one representative
+// ExpectedReachable: false pair for every distinct VPC pair in vpcNames
+// that has no permit entry at all.
+func connTuples(vpcNames []string, subnetsPerVPC, serversPerSubnet int, vpcPeerings map[string]*vpcapi.VPCPeeringSpec, extPeerings map[string]*vpcapi.ExternalPeeringSpec) []connTuple {
+	var tuples []connTuple
+
+	peeredPair := map[[2]string]bool{}
+
+	names := make([]string, 0, len(vpcPeerings))
+	for name := range vpcPeerings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		spec := vpcPeerings[name]
+		for _, permit := range spec.Permit {
+			vpcs := make([]string, 0, len(permit))
+			for vpc := range permit {
+				vpcs = append(vpcs, vpc)
+			}
+			if len(vpcs) != 2 {
+				continue
+			}
+			sort.Strings(vpcs)
+
+			peeredPair[[2]string{vpcs[0], vpcs[1]}] = true
+
+			subnets := subnetIndices(permit[vpcs[0]].Subnets, subnetsPerVPC)
+			for _, subnet := range subnets {
+				for server := 1; server <= serversPerSubnet; server++ {
+					tuples = append(tuples, connTuple{
+						src:               serverName(vpcs[0], subnet, server),
+						dst:               serverName(vpcs[1], subnet, server),
+						expectedReachable: true,
+					})
+				}
+			}
+		}
+	}
+
+	extNames := make([]string, 0, len(extPeerings))
+	for name := range extPeerings {
+		extNames = append(extNames, name)
+	}
+	sort.Strings(extNames)
+
+	for _, name := range extNames {
+		spec := extPeerings[name]
+		subnets := subnetIndices(spec.Permit.VPC.Subnets, subnetsPerVPC)
+		for _, subnet := range subnets {
+			for server := 1; server <= serversPerSubnet; server++ {
+				tuples = append(tuples, connTuple{
+					src:               serverName(spec.Permit.VPC.Name, subnet, server),
+					dst:               spec.Permit.External.Name,
+					expectedReachable: true,
+				})
+			}
+		}
+	}
+
+	sortedVPCs := append([]string(nil), vpcNames...)
+	sort.Strings(sortedVPCs)
+	for i, a := range sortedVPCs {
+		for _, b := range sortedVPCs[i+1:] {
+			if peeredPair[[2]string{a, b}] {
+				continue
+			}
+			tuples = append(tuples, connTuple{
+				src:               serverName(a, 1, 1),
+				dst:               serverName(b, 1, 1),
+				expectedReachable: false,
+			})
+		}
+	}
+
+	return tuples
+}
+
+// serverName is the hostname VLAB gives the n'th server (1-indexed) in the
+// subnet'th subnet (1-indexed) of vpc.
+func serverName(vpc string, subnet, server int) string {
+	return fmt.Sprintf("%s-s%02d-server-%02d", vpc, subnet, server)
+}
+
+// subnetIndices returns the 1-indexed subnet numbers a permit's Subnets
+// list refers to (parsed from the "subnet-NN" names DoSetupPeerings
+// consumes), or every subnet in the VPC if the permit didn't restrict to
+// specific ones.
+func subnetIndices(permitted []string, subnetsPerVPC int) []int {
+	if len(permitted) == 0 {
+		idx := make([]int, subnetsPerVPC)
+		for i := range idx {
+			idx[i] = i + 1
+		}
+
+		return idx
+	}
+
+	idx := make([]int, 0, len(permitted))
+	for _, s := range permitted {
+		var n int
+		if _, err := fmt.Sscanf(s, "subnet-%d", &n); err == nil {
+			idx = append(idx, n)
+		}
+	}
+
+	return idx
+}
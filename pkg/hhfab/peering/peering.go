@@ -0,0 +1,387 @@
+// Copyright 2024 Hedgehog
+// SPDX-License-Identifier: Apache-2.0
+
+// Package peering establishes VPC peerings between two independent
+// Fabricator installations, borrowing the cluster-peering model where one
+// side generates a bearer token embedding everything the other side needs
+// to initiate, and both sides keep enough state to reconcile or tear the
+// peering down later.
+//
+// The token is signed with the generating fabric's own Ed25519 identity
+// key rather than a key shared out-of-band: the matching public key
+// travels inside the token itself, so any fabric can verify the token's
+// integrity without first provisioning a shared secret with every peer it
+// might ever talk to. As with any self-signed credential (an SSH host key
+// on first connect, a Kubernetes bootstrap token), the operator handing
+// the token to the remote side is what vouches for the fabric identity
+// it claims - the signature only proves the token hasn't been tampered
+// with in transit.
+package peering
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	vpcapi "go.githedgehog.com/fabric/api/vpc/v1beta1"
+	fabapi "go.githedgehog.com/fabricator/api/fabricator/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// stateNamespace is where cross-fabric peering state and the local
+	// identity key are kept, mirroring how other fabricator components
+	// stash their reconciliation state in-cluster rather than on local
+	// disk.
+	stateNamespace = "fab"
+	sharedKeySize  = 32
+	tokenTTL       = 15 * time.Minute
+)
+
+// GenerateTokenOpts controls what a peering token exports about the local
+// VPC.
+type GenerateTokenOpts struct {
+	Subnets []string
+	VNI     uint32
+	ASN     uint32
+	TTL     time.Duration
+}
+
+// EstablishOpts controls how a peering is materialized on the receiving
+// fabric.
+type EstablishOpts struct {
+	// Remote is the name the remote peer is known by locally; defaults to
+	// the fabric identity embedded in the token.
+	Remote string
+}
+
+// tokenPayload is the plaintext embedded in a peering token. It is never
+// secret by itself (it travels over whatever channel the operator chooses
+// to hand the token to the remote side). PublicKey is the generating
+// fabric's Ed25519 identity public key, included so the receiving side can
+// verify the signature without having exchanged any key material up
+// front.
+type tokenPayload struct {
+	FabricID  string            `json:"fabricId"`
+	PublicKey ed25519.PublicKey `json:"publicKey"`
+	VPC       string            `json:"vpc"`
+	Subnets   []string          `json:"subnets"`
+	VNI       uint32            `json:"vni,omitempty"`
+	ASN       uint32            `json:"asn,omitempty"`
+	Secret    string            `json:"secret"`
+	IssuedAt  int64             `json:"issuedAt"`
+	TTL       int64             `json:"ttl"`
+}
+
+// State is the record kept on both ends of a cross-fabric peering so it can
+// be reconciled or torn down later. It is stored as a Secret in the local
+// cluster, keyed by peering name.
+type State struct {
+	PeeringName    string `json:"peeringName"`
+	LocalVPC       string `json:"localVpc"`
+	RemoteFabricID string `json:"remoteFabricId"`
+	RemoteVPC      string `json:"remoteVpc"`
+	SharedSecret   string `json:"sharedSecret"`
+	CreatedAt      int64  `json:"createdAt"`
+}
+
+// GeneratePeeringToken mints an opaque, signed token that a remote fabric
+// can use to initiate a VPC peering with vpcName on this fabric. The token
+// embeds the local fabric identity, its Ed25519 public key, the VPC's
+// exported subnets, VNI/ASN hints, and a freshly generated shared secret
+// that both ends record in their peering State. Stale tokens are rejected by
+// their TTL; nothing in this package checks the secret against replays.
+func GeneratePeeringToken(ctx context.Context, kube client.Client, vpcName string, opts GenerateTokenOpts) (string, error) {
+	fabricID, err := localFabricID(ctx, kube)
+	if err != nil {
+		return "", fmt.Errorf("reading local fabric identity: %w", err)
+	}
+
+	identityKey, err := identityKey(ctx, kube)
+	if err != nil {
+		return "", fmt.Errorf("reading identity key: %w", err)
+	}
+
+	secret, err := randomKey(sharedKeySize)
+	if err != nil {
+		return "", fmt.Errorf("rotating shared secret: %w", err)
+	}
+
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = tokenTTL
+	}
+
+	payload := tokenPayload{
+		FabricID:  fabricID,
+		PublicKey: identityKey.Public().(ed25519.PublicKey),
+		VPC:       vpcName,
+		Subnets:   opts.Subnets,
+		VNI:       opts.VNI,
+		ASN:       opts.ASN,
+		Secret:    secret,
+		IssuedAt:  time.Now().Unix(),
+		TTL:       int64(ttl.Seconds()),
+	}
+
+	encoded, err := encodeToken(payload, identityKey)
+	if err != nil {
+		return "", err
+	}
+
+	if err := storeState(ctx, kube, State{
+		PeeringName:    peeringName(fabricID, vpcName),
+		LocalVPC:       vpcName,
+		RemoteFabricID: "", // unknown until the remote side initiates
+		SharedSecret:   secret,
+		CreatedAt:      payload.IssuedAt,
+	}); err != nil {
+		return "", fmt.Errorf("storing peering state: %w", err)
+	}
+
+	return encoded, nil
+}
+
+// EstablishPeering decodes a token minted by GeneratePeeringToken, verifies
+// its signature against the public key embedded in the token itself and
+// checks its expiry, stores the peering State on this fabric, and builds
+// the matching VPCPeeringSpec / ExternalPeeringSpec so localVPC can be
+// peered with the remote VPC the token describes. It does not apply the
+// specs to the cluster: it returns them so the caller can feed them into
+// DoSetupPeerings the same way a same-fabric peering would be set up.
+func EstablishPeering(ctx context.Context, kube client.Client, token, localVPC string, opts EstablishOpts) (*vpcapi.VPCPeeringSpec, *vpcapi.ExternalPeeringSpec, error) {
+	payload, err := decodeToken(token)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding peering token: %w", err)
+	}
+
+	if expired := time.Unix(payload.IssuedAt, 0).Add(time.Duration(payload.TTL) * time.Second).Before(time.Now()); expired {
+		return nil, nil, fmt.Errorf("peering token for vpc %q expired", payload.VPC)
+	}
+
+	remote := opts.Remote
+	if remote == "" {
+		remote = payload.FabricID
+	}
+
+	// The remote VPC has no object on this fabric to reference by its bare
+	// name - and if the operator happens to name local and remote VPCs the
+	// same (localVPC == payload.VPC), a permit map keyed by bare names would
+	// silently collapse to one entry. Namespace the remote side's key by
+	// the remote identity so it can never collide with localVPC and never
+	// reads as a literal local object name.
+	remoteKey := remote + "/" + payload.VPC
+	if remoteKey == localVPC {
+		return nil, nil, fmt.Errorf("remote peering key %q collides with local vpc name %q", remoteKey, localVPC)
+	}
+
+	name := peeringName(payload.FabricID, payload.VPC)
+	if err := storeState(ctx, kube, State{
+		PeeringName:    name,
+		LocalVPC:       localVPC,
+		RemoteFabricID: payload.FabricID,
+		RemoteVPC:      payload.VPC,
+		SharedSecret:   payload.Secret,
+		CreatedAt:      time.Now().Unix(),
+	}); err != nil {
+		return nil, nil, fmt.Errorf("storing peering state: %w", err)
+	}
+
+	vpcPeering := &vpcapi.VPCPeeringSpec{
+		Remote: remote,
+		Permit: []map[string]vpcapi.VPCPeer{
+			{
+				localVPC:  vpcapi.VPCPeer{},
+				remoteKey: vpcapi.VPCPeer{Subnets: payload.Subnets},
+			},
+		},
+	}
+
+	extPeering := &vpcapi.ExternalPeeringSpec{
+		Permit: vpcapi.ExternalPeeringSpecPermit{
+			VPC: vpcapi.ExternalPeeringSpecVPC{
+				Name: localVPC,
+			},
+			External: vpcapi.ExternalPeeringSpecExternal{
+				Name: remote,
+			},
+		},
+	}
+
+	return vpcPeering, extPeering, nil
+}
+
+// Teardown removes the locally stored state for a cross-fabric peering.
+// Callers are expected to also remove any VPCPeeringSpec / ExternalPeeringSpec
+// they applied via DoSetupPeerings; Teardown only clears the bookkeeping
+// this package owns.
+func Teardown(ctx context.Context, kube client.Client, peeringName string) error {
+	secret := &corev1.Secret{}
+	secret.Namespace = stateNamespace
+	secret.Name = stateSecretName(peeringName)
+
+	if err := kube.Delete(ctx, secret); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("deleting peering state %q: %w", peeringName, err)
+	}
+
+	return nil
+}
+
+func peeringName(fabricID, vpc string) string {
+	return fmt.Sprintf("%s--%s", fabricID, vpc)
+}
+
+func stateSecretName(peeringName string) string {
+	return "hhfab-peering-" + peeringName
+}
+
+func storeState(ctx context.Context, kube client.Client, state State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("marshaling peering state: %w", err)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: stateNamespace,
+			Name:      stateSecretName(state.PeeringName),
+			Labels: map[string]string{
+				"fabricator.githedgehog.com/cross-fabric-peering": state.PeeringName,
+			},
+		},
+		Data: map[string][]byte{"state": data},
+	}
+
+	existing := &corev1.Secret{}
+	err = kube.Get(ctx, client.ObjectKeyFromObject(secret), existing)
+	if apierrors.IsNotFound(err) {
+		return kube.Create(ctx, secret)
+	}
+	if err != nil {
+		return fmt.Errorf("getting existing peering state %q: %w", state.PeeringName, err)
+	}
+
+	existing.Data = secret.Data
+	existing.Labels = secret.Labels
+
+	return kube.Update(ctx, existing)
+}
+
+func localFabricID(ctx context.Context, kube client.Client) (string, error) {
+	fabs := &fabapi.FabricatorList{}
+	if err := kube.List(ctx, fabs); err != nil {
+		return "", fmt.Errorf("listing fabricators: %w", err)
+	}
+	if len(fabs.Items) != 1 {
+		return "", fmt.Errorf("expected exactly one fabricator, got %d", len(fabs.Items))
+	}
+
+	return string(fabs.Items[0].GetUID()), nil
+}
+
+// identityKey returns this fabric's Ed25519 signing identity, generating
+// and persisting one on first use. Unlike the old shared-secret design,
+// this key never needs to match anything on the remote fabric: only its
+// public half - embedded in every token minted here - is needed to verify
+// a token's signature.
+func identityKey(ctx context.Context, kube client.Client) (ed25519.PrivateKey, error) {
+	secret := &corev1.Secret{}
+	key := client.ObjectKey{Namespace: stateNamespace, Name: "hhfab-peering-identity-key"}
+
+	if err := kube.Get(ctx, key, secret); err == nil {
+		seed := secret.Data["seed"]
+		if len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("identity key secret %q has a corrupt seed", key.Name)
+		}
+
+		return ed25519.NewKeyFromSeed(seed), nil
+	} else if !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("getting identity key secret: %w", err)
+	}
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generating identity key: %w", err)
+	}
+
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+		Data:       map[string][]byte{"seed": priv.Seed()},
+	}
+	if err := kube.Create(ctx, secret); err != nil {
+		return nil, fmt.Errorf("creating identity key secret: %w", err)
+	}
+
+	return priv, nil
+}
+
+func randomKey(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generating random key: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func encodeToken(payload tokenPayload, identityKey ed25519.PrivateKey) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("marshaling token payload: %w", err)
+	}
+
+	sig := ed25519.Sign(identityKey, data)
+
+	return base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// decodeToken verifies the token's signature against the public key
+// embedded in its own payload: the payload (public key included) is what
+// was signed, so tampering with either the claims or the embedded key
+// invalidates the signature.
+func decodeToken(token string) (tokenPayload, error) {
+	var payload tokenPayload
+
+	dot := -1
+	for i := len(token) - 1; i >= 0; i-- {
+		if token[i] == '.' {
+			dot = i
+
+			break
+		}
+	}
+	if dot < 0 {
+		return payload, fmt.Errorf("malformed token")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token[:dot])
+	if err != nil {
+		return payload, fmt.Errorf("decoding token payload: %w", err)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(token[dot+1:])
+	if err != nil {
+		return payload, fmt.Errorf("decoding token signature: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return payload, fmt.Errorf("unmarshaling token payload: %w", err)
+	}
+
+	if len(payload.PublicKey) != ed25519.PublicKeySize {
+		return payload, fmt.Errorf("invalid token signature")
+	}
+
+	if !ed25519.Verify(payload.PublicKey, data, sig) {
+		return payload, fmt.Errorf("invalid token signature")
+	}
+
+	return payload, nil
+}
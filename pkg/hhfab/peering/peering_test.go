@@ -0,0 +1,124 @@
+// Copyright 2024 Hedgehog
+// SPDX-License-Identifier: Apache-2.0
+
+package peering
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fabapi "go.githedgehog.com/fabricator/api/fabricator/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func fakeKube(t *testing.T) *fake.ClientBuilder {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, fabapi.AddToScheme(scheme))
+
+	fab := &fabapi.Fabricator{ObjectMeta: metav1.ObjectMeta{Namespace: stateNamespace, Name: "default"}}
+
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(fab)
+}
+
+func TestGenerateAndEstablishRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	kube := fakeKube(t).Build()
+
+	fabricID, err := localFabricID(ctx, kube)
+	require.NoError(t, err)
+
+	token, err := GeneratePeeringToken(ctx, kube, "vpc-01", GenerateTokenOpts{
+		Subnets: []string{"subnet-01"},
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, token)
+
+	vpcPeering, extPeering, err := EstablishPeering(ctx, kube, token, "vpc-02", EstablishOpts{})
+	require.NoError(t, err)
+	require.Len(t, vpcPeering.Permit, 1)
+
+	remoteKey := fabricID + "/vpc-01"
+	assert.Contains(t, vpcPeering.Permit[0], "vpc-02")
+	assert.Contains(t, vpcPeering.Permit[0], remoteKey)
+	assert.Equal(t, []string{"subnet-01"}, vpcPeering.Permit[0][remoteKey].Subnets)
+	assert.Equal(t, "vpc-02", extPeering.Permit.VPC.Name)
+}
+
+// TestEstablishRejectsCollidingVPCNames guards against the permit map
+// literal silently collapsing when the local VPC name equals the namespaced
+// "<fabric>/<vpc>" key the remote side is stored under.
+func TestEstablishRejectsCollidingVPCNames(t *testing.T) {
+	ctx := context.Background()
+	kube := fakeKube(t).Build()
+
+	fabricID, err := localFabricID(ctx, kube)
+	require.NoError(t, err)
+
+	token, err := GeneratePeeringToken(ctx, kube, "vpc-01", GenerateTokenOpts{})
+	require.NoError(t, err)
+
+	_, _, err = EstablishPeering(ctx, kube, token, fabricID+"/vpc-01", EstablishOpts{})
+	assert.ErrorContains(t, err, "collides")
+}
+
+func TestGenerateAndEstablishAcrossIndependentFabrics(t *testing.T) {
+	ctx := context.Background()
+	generating := fakeKube(t).Build()
+	establishing := fakeKube(t).Build()
+
+	generatingFabricID, err := localFabricID(ctx, generating)
+	require.NoError(t, err)
+
+	token, err := GeneratePeeringToken(ctx, generating, "vpc-01", GenerateTokenOpts{
+		Subnets: []string{"subnet-01"},
+	})
+	require.NoError(t, err)
+
+	vpcPeering, _, err := EstablishPeering(ctx, establishing, token, "vpc-02", EstablishOpts{})
+	require.NoError(t, err, "a token minted on one fabric's client must verify on a completely independent one")
+	assert.Equal(t, []string{"subnet-01"}, vpcPeering.Permit[0][generatingFabricID+"/vpc-01"].Subnets)
+}
+
+func TestEstablishRejectsTamperedToken(t *testing.T) {
+	ctx := context.Background()
+	kube := fakeKube(t).Build()
+
+	token, err := GeneratePeeringToken(ctx, kube, "vpc-01", GenerateTokenOpts{})
+	require.NoError(t, err)
+
+	// Alter the first payload character: it always decodes to a different
+	// leading byte, whereas the signature's last character carries unused
+	// padding bits and can decode unchanged.
+	tampered := "x" + token[1:]
+	_, _, err = EstablishPeering(ctx, kube, tampered, "vpc-02", EstablishOpts{})
+	assert.Error(t, err)
+}
+
+func TestEstablishRejectsExpiredToken(t *testing.T) {
+	ctx := context.Background()
+	kube := fakeKube(t).Build()
+
+	token, err := GeneratePeeringToken(ctx, kube, "vpc-01", GenerateTokenOpts{TTL: time.Nanosecond})
+	require.NoError(t, err)
+
+	time.Sleep(time.Millisecond)
+
+	_, _, err = EstablishPeering(ctx, kube, token, "vpc-02", EstablishOpts{})
+	assert.ErrorContains(t, err, "expired")
+}
+
+func TestTeardownIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	kube := fakeKube(t).Build()
+
+	assert.NoError(t, Teardown(ctx, kube, "does-not-exist"))
+}
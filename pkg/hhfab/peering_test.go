@@ -1,100 +1,70 @@
 // Copyright 2024 Hedgehog
 // SPDX-License-Identifier: Apache-2.0
 
-package hhfab
+package hhfab_test
 
 import (
-	"context"
-	"fmt"
 	"os"
 	"path/filepath"
-	"time"
+	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	vpcapi "go.githedgehog.com/fabric/api/vpc/v1beta1"
-	"go.githedgehog.com/fabric/pkg/hhfctl"
-	"sigs.k8s.io/controller-runtime/pkg/client"
+	"go.githedgehog.com/fabricator/pkg/hhfab"
+	"go.githedgehog.com/fabricator/pkg/hhfab/peering"
+	"go.githedgehog.com/fabricator/pkg/hhfab/peeringdsl"
+	"go.githedgehog.com/fabricator/pkg/hhfabtest"
 )
 
+func init() {
+	hhfabtest.Register("vpc-peerings", "TestVPCPeeringsSuite", func() suite.TestingSuite { return &VPCPeeringsSuite{} })
+}
+
 type VPCPeeringsSuite struct {
-	suite.Suite
-	workDir          string
-	cacheDir         string
-	ctx              context.Context
-	ctxCancel        context.CancelFunc
-	kube             client.Client
-	wipeBetweenTests bool
-	opts             SetupVPCsOpts
-	tcOpts           TestConnectivityOpts
+	hhfabtest.BaseSuite
 }
 
-func (suite *VPCPeeringsSuite) SetupSuite() {
-	var err error
-	err = getEnvVars(&suite.workDir, &suite.cacheDir)
-	assert.Nil(suite.T(), err)
-	suite.ctx, suite.ctxCancel = context.WithTimeout(context.Background(), 10*time.Minute)
-	suite.kube, err = GetKubeClient(suite.ctx, suite.workDir)
-	assert.Nil(suite.T(), err)
-	suite.wipeBetweenTests = true
-	suite.opts = SetupVPCsOpts{
-		WaitSwitchesReady: true,
-		ForceCleanup:      false,
-		ServersPerSubnet:  1,
-		SubnetsPerVPC:     1,
-		VLANNamespace:     "default",
-		IPv4Namespace:     "default",
-	}
-	suite.tcOpts = TestConnectivityOpts{
-		WaitSwitchesReady: true,
-	}
+// TestVPCPeeringsSuite is the `go test`-discoverable entry point testify
+// needs to run VPCPeeringsSuite - both directly via `go test -run` and,
+// scoped to just this suite, via `hhfab test run --suite=vpc-peerings`.
+func TestVPCPeeringsSuite(t *testing.T) {
+	suite.Run(t, new(VPCPeeringsSuite))
 }
 
-func appendVpcPeeringSpec(vpcPeerings map[string]*vpcapi.VPCPeeringSpec, index1, index2 int, remote string, vpc1Subnets, vpc2Subnets []string) {
-	vpc1 := fmt.Sprintf("vpc-%02d", index1)
-	vpc2 := fmt.Sprintf("vpc-%02d", index2)
-	entryName := fmt.Sprintf("%s--%s", vpc1, vpc2)
-	vpc1SP := vpcapi.VPCPeer{}
-	vpc1SP.Subnets = vpc1Subnets
-	vpc2SP := vpcapi.VPCPeer{}
-	vpc2SP.Subnets = vpc2Subnets
-	vpcPeerings[entryName] = &vpcapi.VPCPeeringSpec{
-		Remote: remote,
-		Permit: []map[string]vpcapi.VPCPeer{
-			{
-				vpc1: vpc1SP,
-				vpc2: vpc2SP,
-			},
-		},
-	}
+func (s *VPCPeeringsSuite) TestVPCPeeringsStarter() {
+	defer s.CtxCancel()
+
+	s.WipeAndSetupVPCs()
+
+	vpcPeerings, externalPeerings, err := peeringdsl.Parse(
+		"1+2 1+3 3+5 2+4 4+6 5+6 5~default--5835:s=subnet-01 6~default--5835:s=subnet-01 1~default--5835:s=subnet-01 2~default--5835:s=subnet-01",
+	)
+	assert.Nil(s.T(), err)
+
+	s.SetupPeeringsAndTest(vpcPeerings, externalPeerings)
 }
 
-func appendExtPeeringSpec(extPeerings map[string]*vpcapi.ExternalPeeringSpec, vpcIndex int, ext string, subnets []string, prefixes []string) {
-	entryName := fmt.Sprintf("vpc-%02d--%s", vpcIndex, ext)
-	vpc := fmt.Sprintf("vpc-%02d", vpcIndex)
-	prefixesSpec := make([]vpcapi.ExternalPeeringSpecPrefix, len(prefixes))
-	for i, prefix := range prefixes {
-		prefixesSpec[i] = vpcapi.ExternalPeeringSpecPrefix{
-			Prefix: prefix,
-		}
-	}
-	extPeerings[entryName] = &vpcapi.ExternalPeeringSpec{
-		Permit: vpcapi.ExternalPeeringSpecPermit{
-			VPC: vpcapi.ExternalPeeringSpecVPC{
-				Name:    vpc,
-				Subnets: subnets,
-			},
-			External: vpcapi.ExternalPeeringSpecExternal{
-				Name:     ext,
-				Prefixes: prefixesSpec,
-			},
-		},
-	}
+func (s *VPCPeeringsSuite) TestVPCPeeringsFullMeshPlusExternal() {
+	defer s.CtxCancel()
+
+	s.WipeAndSetupVPCs()
+
+	vpcPeerings, externalPeerings, err := peeringdsl.Parse(
+		"1+2 5+6 1+3 1+4 1+5 1+6 2+6 2+4 2+3 2+5 3+4 3+5 3+6 4+5 4+6 1~default--5835:s=subnet-01 2~default--5835:s=subnet-01",
+	)
+	assert.Nil(s.T(), err)
+
+	s.SetupPeeringsAndTest(vpcPeerings, externalPeerings)
 }
 
-func getEnvVars(workDir, cacheDir *string) error {
-	*workDir = os.Getenv("HHFAB_WORK_DIR")
-	*cacheDir = os.Getenv("HHFAB_CACHE_DIR")
+// getEnvVarsSecondary resolves the work/cache dirs for the second VLAB used
+// by TestCrossFabricPeering from HHFAB_WORK_DIR_2 / HHFAB_CACHE_DIR_2,
+// falling back to ~/hhfab-2 and ~/.hhfab-cache-2, so a single host can run
+// both fabrics.
+func getEnvVarsSecondary(workDir, cacheDir *string) error {
+	*workDir = os.Getenv("HHFAB_WORK_DIR_2")
+	*cacheDir = os.Getenv("HHFAB_CACHE_DIR_2")
 
 	if *workDir == "" || *cacheDir == "" {
 		home, err := os.UserHomeDir()
@@ -102,97 +72,45 @@ func getEnvVars(workDir, cacheDir *string) error {
 			return err
 		}
 		if *workDir == "" {
-			*workDir = filepath.Join(home, "hhfab")
+			*workDir = filepath.Join(home, "hhfab-2")
 		}
 		if *cacheDir == "" {
-			*cacheDir = filepath.Join(home, ".hhfab-cache")
+			*cacheDir = filepath.Join(home, ".hhfab-cache-2")
 		}
 	}
 
 	return nil
 }
 
-func (suite *VPCPeeringsSuite) TestVPCPeeringsStarter() {
-	defer suite.ctxCancel()
+// TestCrossFabricPeering sets up VPCs on a second, independent VLAB that is
+// already running in the secondary work dir (it does not start that VLAB),
+// generates a peering token on it for vpc-01, initiates the peering from
+// the suite's primary VLAB, and confirms connectivity end-to-end.
+func (s *VPCPeeringsSuite) TestCrossFabricPeering() {
+	defer s.CtxCancel()
 
-	// FIXME: Remove me once the gnmi issue is fixed
-	if suite.wipeBetweenTests {
-		if err := hhfctl.VPCWipe(suite.ctx); err != nil {
-			suite.T().Fatalf("VPCWipe: %v", err)
-		}
-	}
+	remoteWorkDir, remoteCacheDir := "", ""
+	assert.Nil(s.T(), getEnvVarsSecondary(&remoteWorkDir, &remoteCacheDir))
 
-	if err := DoVLABSetupVPCs(suite.ctx, suite.workDir, suite.cacheDir, suite.opts); err != nil {
-		suite.T().Fatalf("DoVLABSetupVPCs: %v", err)
-	}
-	extName := "default--5835"
-	emptyStr := []string{}
-
-	// 1+2 1+3 3+5 2+4 4+6 5+6 5~default--5835:s=subnet-01 6~default--5835:s=subnet-01  1~default--5835:s=subnet-01  2~default--5835:s=subnet-01
-	vpcPeerings := make(map[string]*vpcapi.VPCPeeringSpec, 6)
-	appendVpcPeeringSpec(vpcPeerings, 1, 2, "", emptyStr, emptyStr)
-	appendVpcPeeringSpec(vpcPeerings, 1, 3, "", emptyStr, emptyStr)
-	appendVpcPeeringSpec(vpcPeerings, 3, 5, "", emptyStr, emptyStr)
-	appendVpcPeeringSpec(vpcPeerings, 2, 4, "", emptyStr, emptyStr)
-	appendVpcPeeringSpec(vpcPeerings, 4, 6, "", emptyStr, emptyStr)
-	appendVpcPeeringSpec(vpcPeerings, 5, 6, "", emptyStr, emptyStr)
-
-	externalPeerings := make(map[string]*vpcapi.ExternalPeeringSpec, 4)
-	appendExtPeeringSpec(externalPeerings, 5, extName, []string{"subnet-01"}, emptyStr)
-	appendExtPeeringSpec(externalPeerings, 6, extName, []string{"subnet-01"}, emptyStr)
-	appendExtPeeringSpec(externalPeerings, 1, extName, []string{"subnet-01"}, emptyStr)
-	appendExtPeeringSpec(externalPeerings, 2, extName, []string{"subnet-01"}, emptyStr)
-
-	if err := DoSetupPeerings(suite.ctx, suite.kube, vpcPeerings, externalPeerings, true); err != nil {
-		suite.T().Fatalf("DoSetupPeerings: %v", err)
-	}
-	if err := DoVLABTestConnectivity(suite.ctx, suite.workDir, suite.cacheDir, suite.tcOpts); err != nil {
-		suite.T().Fatalf("DoVLABTestConnectivity: %v", err)
+	remoteKube, err := hhfab.GetKubeClient(s.Ctx, remoteWorkDir)
+	assert.Nil(s.T(), err)
+
+	if err := hhfab.DoVLABSetupVPCs(s.Ctx, remoteWorkDir, remoteCacheDir, s.Opts); err != nil {
+		s.T().Fatalf("DoVLABSetupVPCs (remote): %v", err)
 	}
-}
 
-func (suite *VPCPeeringsSuite) TestVPCPeeringsFullMeshPlusExternal() {
-	defer suite.ctxCancel()
+	s.WipeAndSetupVPCs()
 
-	// FIXME: Remove me once the gnmi issue is fixed
-	if suite.wipeBetweenTests {
-		if err := hhfctl.VPCWipe(suite.ctx); err != nil {
-			suite.T().Fatalf("VPCWipe: %v", err)
-		}
-	}
+	token, err := peering.GeneratePeeringToken(s.Ctx, remoteKube, "vpc-01", peering.GenerateTokenOpts{
+		Subnets: []string{"subnet-01"},
+	})
+	assert.Nil(s.T(), err)
 
-	if err := DoVLABSetupVPCs(suite.ctx, suite.workDir, suite.cacheDir, suite.opts); err != nil {
-		suite.T().Fatalf("DoVLABSetupVPCs: %v", err)
-	}
-	extName := "default--5835"
-	emptyStr := []string{}
-
-	// 1+2 5+6 1+3 1+4 1+5 1+6 2+6 2+4 2+3 2+5 3+4 3+5 3+6 4+5 4+6 1~default--5835:s=subnet-01 2~default--5835:s=subnet-01
-	vpcPeerings := make(map[string]*vpcapi.VPCPeeringSpec, 15)
-	appendVpcPeeringSpec(vpcPeerings, 1, 2, "", emptyStr, emptyStr)
-	appendVpcPeeringSpec(vpcPeerings, 1, 3, "", emptyStr, emptyStr)
-	appendVpcPeeringSpec(vpcPeerings, 1, 4, "", emptyStr, emptyStr)
-	appendVpcPeeringSpec(vpcPeerings, 1, 5, "", emptyStr, emptyStr)
-	appendVpcPeeringSpec(vpcPeerings, 1, 6, "", emptyStr, emptyStr)
-	appendVpcPeeringSpec(vpcPeerings, 2, 3, "", emptyStr, emptyStr)
-	appendVpcPeeringSpec(vpcPeerings, 2, 4, "", emptyStr, emptyStr)
-	appendVpcPeeringSpec(vpcPeerings, 2, 5, "", emptyStr, emptyStr)
-	appendVpcPeeringSpec(vpcPeerings, 2, 6, "", emptyStr, emptyStr)
-	appendVpcPeeringSpec(vpcPeerings, 3, 4, "", emptyStr, emptyStr)
-	appendVpcPeeringSpec(vpcPeerings, 3, 5, "", emptyStr, emptyStr)
-	appendVpcPeeringSpec(vpcPeerings, 3, 6, "", emptyStr, emptyStr)
-	appendVpcPeeringSpec(vpcPeerings, 4, 5, "", emptyStr, emptyStr)
-	appendVpcPeeringSpec(vpcPeerings, 4, 6, "", emptyStr, emptyStr)
-	appendVpcPeeringSpec(vpcPeerings, 5, 6, "", emptyStr, emptyStr)
-
-	externalPeerings := make(map[string]*vpcapi.ExternalPeeringSpec, 2)
-	appendExtPeeringSpec(externalPeerings, 1, extName, []string{"subnet-01"}, emptyStr)
-	appendExtPeeringSpec(externalPeerings, 2, extName, []string{"subnet-01"}, emptyStr)
-
-	if err := DoSetupPeerings(suite.ctx, suite.kube, vpcPeerings, externalPeerings, true); err != nil {
-		suite.T().Fatalf("DoSetupPeerings: %v", err)
-	}
-	if err := DoVLABTestConnectivity(suite.ctx, suite.workDir, suite.cacheDir, suite.tcOpts); err != nil {
-		suite.T().Fatalf("DoVLABTestConnectivity: %v", err)
-	}
+	vpcPeering, extPeering, err := peering.EstablishPeering(s.Ctx, s.Kube, token, "vpc-01", peering.EstablishOpts{})
+	assert.Nil(s.T(), err)
+
+	vpcPeerings := map[string]*vpcapi.VPCPeeringSpec{"vpc-01--remote": vpcPeering}
+	externalPeerings := map[string]*vpcapi.ExternalPeeringSpec{"vpc-01--remote": extPeering}
+
+	s.SetupPeeringsAndTest(vpcPeerings, externalPeerings)
 }
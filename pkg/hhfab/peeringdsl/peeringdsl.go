@@ -0,0 +1,293 @@
+// Copyright 2024 Hedgehog
+// SPDX-License-Identifier: Apache-2.0
+
+// Package peeringdsl turns the terse shorthand already used in test comments
+// (e.g. "1+2 1+3 3+5 5~default--5835:s=subnet-01") into the VPCPeeringSpec
+// and ExternalPeeringSpec maps consumed by DoSetupPeerings, so the comment
+// and the code describing a scenario can never drift apart.
+//
+// Grammar, tokens separated by whitespace:
+//
+//	1+2                    VPC peering between vpc-01 and vpc-02
+//	1..6+7                 range sugar: vpc-01+vpc-07, vpc-02+vpc-07, ... vpc-06+vpc-07
+//	mesh(1..6)             full-mesh sugar: a peering for every pair in 1..6
+//	1[s=subnet-01]+2[s=subnet-02]   per-side subnet qualifiers
+//	1+2:r=border           sets Remote on that peering
+//	5~default--5835:s=subnet-01     external peering for vpc-05 with subnet-01 permitted
+//	r=border               sets Remote on the most recently parsed VPC peering
+package peeringdsl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	vpcapi "go.githedgehog.com/fabric/api/vpc/v1beta1"
+)
+
+// ParseError reports a shorthand validation failure together with the byte
+// column offset of the offending token, so editors and CI logs can point
+// straight at the mistake.
+type ParseError struct {
+	Column  int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column, e.Message)
+}
+
+func errAt(column int, format string, args ...any) error {
+	return &ParseError{Column: column, Message: fmt.Sprintf(format, args...)}
+}
+
+// Parse parses a peering shorthand expression into the maps expected by
+// DoSetupPeerings.
+func Parse(expr string) (map[string]*vpcapi.VPCPeeringSpec, map[string]*vpcapi.ExternalPeeringSpec, error) {
+	vpcPeerings := map[string]*vpcapi.VPCPeeringSpec{}
+	extPeerings := map[string]*vpcapi.ExternalPeeringSpec{}
+
+	var lastVPCPeering string
+
+	column := 0
+	for _, tok := range strings.Fields(expr) {
+		col := strings.Index(expr[column:], tok) + column
+		column = col + len(tok)
+
+		switch {
+		case strings.HasPrefix(tok, "mesh("):
+			vpcs, err := parseMesh(tok, col)
+			if err != nil {
+				return nil, nil, err
+			}
+			for i := 0; i < len(vpcs); i++ {
+				for j := i + 1; j < len(vpcs); j++ {
+					name := addVPCPeering(vpcPeerings, vpcs[i], nil, vpcs[j], nil, "")
+					lastVPCPeering = name
+				}
+			}
+
+		case strings.HasPrefix(tok, "r="):
+			remote := strings.TrimPrefix(tok, "r=")
+			if remote == "" {
+				return nil, nil, errAt(col, "r= requires a remote name")
+			}
+			if lastVPCPeering == "" {
+				return nil, nil, errAt(col, "r= modifier requires a preceding VPC peering")
+			}
+			vpcPeerings[lastVPCPeering].Remote = remote
+
+		case strings.Contains(tok, "~"):
+			if err := parseExternal(tok, col, extPeerings); err != nil {
+				return nil, nil, err
+			}
+
+		case strings.Contains(tok, "+"):
+			name, err := parseVPCPeering(tok, col, vpcPeerings)
+			if err != nil {
+				return nil, nil, err
+			}
+			lastVPCPeering = name
+
+		default:
+			return nil, nil, errAt(col, "unrecognized token %q", tok)
+		}
+	}
+
+	return vpcPeerings, extPeerings, nil
+}
+
+// side is one "A" or "A..B" or "A[s=subnet-01,subnet-02]" term on one side of
+// a "+".
+type side struct {
+	indexes []int
+	subnets []string
+}
+
+func parseSide(raw string, col int) (side, error) {
+	subnets := []string(nil)
+	if i := strings.Index(raw, "["); i >= 0 {
+		if !strings.HasSuffix(raw, "]") {
+			return side{}, errAt(col, "unterminated bracket qualifier in %q", raw)
+		}
+		qualifier := raw[i+1 : len(raw)-1]
+		raw = raw[:i]
+
+		if !strings.HasPrefix(qualifier, "s=") {
+			return side{}, errAt(col, "unsupported qualifier %q", qualifier)
+		}
+		subnets = strings.Split(strings.TrimPrefix(qualifier, "s="), ",")
+	}
+
+	indexes, err := parseRange(raw, col)
+	if err != nil {
+		return side{}, err
+	}
+
+	return side{indexes: indexes, subnets: subnets}, nil
+}
+
+func parseRange(raw string, col int) ([]int, error) {
+	lo, hi, found := strings.Cut(raw, "..")
+	first, err := strconv.Atoi(lo)
+	if err != nil {
+		return nil, errAt(col, "invalid vpc index %q", lo)
+	}
+	if !found {
+		return []int{first}, nil
+	}
+
+	last, err := strconv.Atoi(hi)
+	if err != nil {
+		return nil, errAt(col, "invalid vpc index %q", hi)
+	}
+	if last < first {
+		return nil, errAt(col, "range %q is backwards", raw)
+	}
+
+	indexes := make([]int, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		indexes = append(indexes, i)
+	}
+
+	return indexes, nil
+}
+
+func parseMesh(tok string, col int) ([]int, error) {
+	if !strings.HasSuffix(tok, ")") {
+		return nil, errAt(col, "unterminated mesh(...) in %q", tok)
+	}
+	inner := strings.TrimSuffix(strings.TrimPrefix(tok, "mesh("), ")")
+
+	return parseRange(inner, col)
+}
+
+func parseVPCPeering(tok string, col int, vpcPeerings map[string]*vpcapi.VPCPeeringSpec) (string, error) {
+	modifier := ""
+	if i := strings.Index(tok, ":"); i >= 0 {
+		modifier = tok[i+1:]
+		tok = tok[:i]
+	}
+
+	lhs, rhs, found := strings.Cut(tok, "+")
+	if !found {
+		return "", errAt(col, "expected A+B, got %q", tok)
+	}
+
+	left, err := parseSide(lhs, col)
+	if err != nil {
+		return "", err
+	}
+	right, err := parseSide(rhs, col)
+	if err != nil {
+		return "", err
+	}
+
+	remote := ""
+	if modifier != "" {
+		if !strings.HasPrefix(modifier, "r=") {
+			return "", errAt(col, "unsupported peering modifier %q", modifier)
+		}
+		remote = strings.TrimPrefix(modifier, "r=")
+	}
+
+	if len(left.indexes) == 1 && len(right.indexes) == 1 {
+		return addVPCPeering(vpcPeerings, left.indexes[0], left.subnets, right.indexes[0], right.subnets, remote), nil
+	}
+
+	// Range sugar: one side may be a range, paired with every index on the
+	// other side (mirroring how "1..6+7" reads as "each of 1..6 with 7").
+	expanded, fixedSubnets, fixed, fixedFixedSubnets, err := expandRangeSides(left, right, col)
+	if err != nil {
+		return "", err
+	}
+
+	var last string
+	for _, idx := range expanded {
+		last = addVPCPeering(vpcPeerings, idx, fixedSubnets, fixed, fixedFixedSubnets, remote)
+	}
+
+	return last, nil
+}
+
+// expandRangeSides validates that exactly one side of a peering token is a
+// range and returns (expandingIndexes, expandingSubnets, fixedIndex, fixedSubnets).
+func expandRangeSides(left, right side, col int) ([]int, []string, int, []string, error) {
+	switch {
+	case len(left.indexes) > 1 && len(right.indexes) == 1:
+		return left.indexes, left.subnets, right.indexes[0], right.subnets, nil
+	case len(right.indexes) > 1 && len(left.indexes) == 1:
+		return right.indexes, right.subnets, left.indexes[0], left.subnets, nil
+	default:
+		return nil, nil, 0, nil, errAt(col, "peering must have a single vpc on at least one side of +")
+	}
+}
+
+func addVPCPeering(vpcPeerings map[string]*vpcapi.VPCPeeringSpec, idx1 int, subnets1 []string, idx2 int, subnets2 []string, remote string) string {
+	vpc1 := fmt.Sprintf("vpc-%02d", idx1)
+	vpc2 := fmt.Sprintf("vpc-%02d", idx2)
+	entryName := fmt.Sprintf("%s--%s", vpc1, vpc2)
+
+	if subnets1 == nil {
+		subnets1 = []string{}
+	}
+	if subnets2 == nil {
+		subnets2 = []string{}
+	}
+
+	vpcPeerings[entryName] = &vpcapi.VPCPeeringSpec{
+		Remote: remote,
+		Permit: []map[string]vpcapi.VPCPeer{
+			{
+				vpc1: vpcapi.VPCPeer{Subnets: subnets1},
+				vpc2: vpcapi.VPCPeer{Subnets: subnets2},
+			},
+		},
+	}
+
+	return entryName
+}
+
+func parseExternal(tok string, col int, extPeerings map[string]*vpcapi.ExternalPeeringSpec) error {
+	subnets := []string(nil)
+	if i := strings.Index(tok, ":"); i >= 0 {
+		qualifier := tok[i+1:]
+		tok = tok[:i]
+
+		if !strings.HasPrefix(qualifier, "s=") {
+			return errAt(col, "unsupported external qualifier %q", qualifier)
+		}
+		subnets = strings.Split(strings.TrimPrefix(qualifier, "s="), ",")
+	}
+
+	idxRaw, ext, found := strings.Cut(tok, "~")
+	if !found || ext == "" {
+		return errAt(col, "expected N~external, got %q", tok)
+	}
+
+	idx, err := strconv.Atoi(idxRaw)
+	if err != nil {
+		return errAt(col, "invalid vpc index %q", idxRaw)
+	}
+
+	vpc := fmt.Sprintf("vpc-%02d", idx)
+	entryName := fmt.Sprintf("%s--%s", vpc, ext)
+
+	if subnets == nil {
+		subnets = []string{}
+	}
+
+	extPeerings[entryName] = &vpcapi.ExternalPeeringSpec{
+		Permit: vpcapi.ExternalPeeringSpecPermit{
+			VPC: vpcapi.ExternalPeeringSpecVPC{
+				Name:    vpc,
+				Subnets: subnets,
+			},
+			External: vpcapi.ExternalPeeringSpecExternal{
+				Name: ext,
+			},
+		},
+	}
+
+	return nil
+}
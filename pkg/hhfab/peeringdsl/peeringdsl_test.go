@@ -0,0 +1,93 @@
+// Copyright 2024 Hedgehog
+// SPDX-License-Identifier: Apache-2.0
+
+package peeringdsl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStarter(t *testing.T) {
+	vpcPeerings, extPeerings, err := Parse(
+		"1+2 1+3 3+5 2+4 4+6 5+6 5~default--5835:s=subnet-01 6~default--5835:s=subnet-01 1~default--5835:s=subnet-01 2~default--5835:s=subnet-01",
+	)
+	require.NoError(t, err)
+	assert.Len(t, vpcPeerings, 6)
+	assert.Len(t, extPeerings, 4)
+
+	peering, ok := vpcPeerings["vpc-01--vpc-02"]
+	require.True(t, ok)
+	assert.Equal(t, "", peering.Remote)
+
+	ext, ok := extPeerings["vpc-05--default--5835"]
+	require.True(t, ok)
+	assert.Equal(t, []string{"subnet-01"}, ext.Permit.VPC.Subnets)
+}
+
+func TestParseFullMeshPlusExternal(t *testing.T) {
+	vpcPeerings, extPeerings, err := Parse(
+		"1+2 5+6 1+3 1+4 1+5 1+6 2+6 2+4 2+3 2+5 3+4 3+5 3+6 4+5 4+6 1~default--5835:s=subnet-01 2~default--5835:s=subnet-01",
+	)
+	require.NoError(t, err)
+	assert.Len(t, vpcPeerings, 15)
+	assert.Len(t, extPeerings, 2)
+}
+
+func TestParseMeshSugar(t *testing.T) {
+	vpcPeerings, _, err := Parse("mesh(1..4)")
+	require.NoError(t, err)
+	assert.Len(t, vpcPeerings, 6) // C(4,2)
+	assert.Contains(t, vpcPeerings, "vpc-01--vpc-02")
+	assert.Contains(t, vpcPeerings, "vpc-03--vpc-04")
+}
+
+func TestParseRangeSugar(t *testing.T) {
+	vpcPeerings, _, err := Parse("1..6+7")
+	require.NoError(t, err)
+	assert.Len(t, vpcPeerings, 6)
+	assert.Contains(t, vpcPeerings, "vpc-01--vpc-07")
+	assert.Contains(t, vpcPeerings, "vpc-06--vpc-07")
+}
+
+func TestParsePerSideSubnets(t *testing.T) {
+	vpcPeerings, _, err := Parse("1[s=subnet-01]+2[s=subnet-02]")
+	require.NoError(t, err)
+	peering := vpcPeerings["vpc-01--vpc-02"]
+	require.NotNil(t, peering)
+	require.Len(t, peering.Permit, 1)
+	assert.Equal(t, []string{"subnet-01"}, peering.Permit[0]["vpc-01"].Subnets)
+	assert.Equal(t, []string{"subnet-02"}, peering.Permit[0]["vpc-02"].Subnets)
+}
+
+func TestParseRemoteModifier(t *testing.T) {
+	vpcPeerings, _, err := Parse("1+2:r=border")
+	require.NoError(t, err)
+	assert.Equal(t, "border", vpcPeerings["vpc-01--vpc-02"].Remote)
+
+	vpcPeerings, _, err = Parse("1+2 r=border")
+	require.NoError(t, err)
+	assert.Equal(t, "border", vpcPeerings["vpc-01--vpc-02"].Remote)
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []string{
+		"1",
+		"1+",
+		"+2",
+		"r=border",
+		"5~",
+		"mesh(1..",
+		"6..1+2",
+		"1+2:bogus=1",
+		"1~default:bogus=1",
+	}
+	for _, c := range cases {
+		_, _, err := Parse(c)
+		assert.Errorf(t, err, "expected error for %q", c)
+		var parseErr *ParseError
+		assert.ErrorAs(t, err, &parseErr)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2024 Hedgehog
+// SPDX-License-Identifier: Apache-2.0
+
+// Package report structures DoVLABTestConnectivity's result as one record
+// per (src, dst) pair instead of a single aggregate error, so triaging a
+// failed 15-peering test doesn't mean re-running it under a debugger to
+// see which pair actually broke.
+package report
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Record is the outcome of testing connectivity between one source and one
+// destination. Src is a server hostname; Dst is either the peer server's
+// hostname (a VPC-pair check) or an external peering's name (a
+// VPC-to-external check, since an external has no server of its own to
+// name).
+type Record struct {
+	Src               string  `json:"src"`
+	Dst               string  `json:"dst"`
+	ExpectedReachable bool    `json:"expectedReachable"`
+	Actual            bool    `json:"actual"`
+	LatencyMs         float64 `json:"latencyMs,omitempty"`
+	Error             string  `json:"error,omitempty"`
+}
+
+// Passed reports whether the record's actual outcome matched expectations.
+func (r Record) Passed() bool {
+	return r.Actual == r.ExpectedReachable
+}
+
+// Matrix is the full set of connectivity records from one test run.
+type Matrix []Record
+
+// Failed returns the subset of records that didn't match expectations.
+func (m Matrix) Failed() Matrix {
+	failed := make(Matrix, 0, len(m))
+	for _, r := range m {
+		if !r.Passed() {
+			failed = append(failed, r)
+		}
+	}
+
+	return failed
+}
+
+// Reporter renders a Matrix somewhere - stdout, a file, CI artifacts.
+type Reporter interface {
+	Report(m Matrix) error
+}
+
+// JSONReporter writes the matrix as a JSON array of Records.
+type JSONReporter struct {
+	W io.Writer
+}
+
+func (r JSONReporter) Report(m Matrix) error {
+	enc := json.NewEncoder(r.W)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(m); err != nil {
+		return fmt.Errorf("encoding connectivity matrix as json: %w", err)
+	}
+
+	return nil
+}
+
+// JUnitReporter writes the matrix as a JUnit XML test suite, one test case
+// per record, so CI can archive and trend it like any other test report.
+type JUnitReporter struct {
+	W    io.Writer
+	Name string
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name    string        `xml:"name,attr"`
+	Failure *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (r JUnitReporter) Report(m Matrix) error {
+	suite := junitTestSuite{
+		Name:  r.Name,
+		Tests: len(m),
+	}
+	if suite.Name == "" {
+		suite.Name = "hhfab-connectivity"
+	}
+
+	for _, rec := range m {
+		tc := junitTestCase{Name: fmt.Sprintf("%s->%s", rec.Src, rec.Dst)}
+		if !rec.Passed() {
+			suite.Failures++
+			msg := fmt.Sprintf("expected reachable=%v, got %v", rec.ExpectedReachable, rec.Actual)
+			tc.Failure = &junitFailure{Message: msg, Text: rec.Error}
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+
+	if _, err := io.WriteString(r.W, xml.Header); err != nil {
+		return fmt.Errorf("writing junit xml header: %w", err)
+	}
+
+	enc := xml.NewEncoder(r.W)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return fmt.Errorf("encoding connectivity matrix as junit xml: %w", err)
+	}
+
+	return nil
+}
+
+// MatrixReporter writes the matrix as an ASCII source x destination grid,
+// "." for an expected pass, "x" for an expected or unexpected failure, and
+// "!" for an unexpected pass (reachable when it shouldn't be) - useful for
+// eyeballing a full-mesh test at a glance.
+type MatrixReporter struct {
+	W io.Writer
+}
+
+func (r MatrixReporter) Report(m Matrix) error {
+	srcs, dsts := axes(m)
+	cell := make(map[[2]string]Record, len(m))
+	for _, rec := range m {
+		cell[[2]string{rec.Src, rec.Dst}] = rec
+	}
+
+	if _, err := fmt.Fprintf(r.W, "%-16s", ""); err != nil {
+		return err
+	}
+	for _, d := range dsts {
+		if _, err := fmt.Fprintf(r.W, " %-10s", d); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintln(r.W); err != nil {
+		return err
+	}
+
+	for _, s := range srcs {
+		if _, err := fmt.Fprintf(r.W, "%-16s", s); err != nil {
+			return err
+		}
+		for _, d := range dsts {
+			rec, ok := cell[[2]string{s, d}]
+			symbol := " "
+			switch {
+			case !ok:
+				symbol = " "
+			case rec.Passed() && rec.ExpectedReachable:
+				symbol = "."
+			case rec.Passed() && !rec.ExpectedReachable:
+				symbol = "x"
+			case rec.Actual:
+				symbol = "!"
+			default:
+				symbol = "x"
+			}
+			if _, err := fmt.Fprintf(r.W, " %-10s", symbol); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(r.W); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func axes(m Matrix) (srcs, dsts []string) {
+	srcSet, dstSet := map[string]bool{}, map[string]bool{}
+	for _, rec := range m {
+		srcSet[rec.Src] = true
+		dstSet[rec.Dst] = true
+	}
+
+	for s := range srcSet {
+		srcs = append(srcs, s)
+	}
+	for d := range dstSet {
+		dsts = append(dsts, d)
+	}
+	sort.Strings(srcs)
+	sort.Strings(dsts)
+
+	return srcs, dsts
+}
@@ -0,0 +1,53 @@
+// Copyright 2024 Hedgehog
+// SPDX-License-Identifier: Apache-2.0
+
+package report
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMatrix() Matrix {
+	return Matrix{
+		{Src: "vpc-01", Dst: "vpc-02", ExpectedReachable: true, Actual: true, LatencyMs: 1.2},
+		{Src: "vpc-01", Dst: "vpc-03", ExpectedReachable: false, Actual: false},
+		{Src: "vpc-02", Dst: "vpc-03", ExpectedReachable: true, Actual: false, Error: "timeout"},
+	}
+}
+
+func TestMatrixFailed(t *testing.T) {
+	failed := testMatrix().Failed()
+	require.Len(t, failed, 1)
+	assert.Equal(t, "vpc-02", failed[0].Src)
+}
+
+func TestJSONReporter(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, JSONReporter{W: &buf}.Report(testMatrix()))
+	assert.Contains(t, buf.String(), `"src": "vpc-01"`)
+	assert.Contains(t, buf.String(), `"error": "timeout"`)
+}
+
+func TestJUnitReporter(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, JUnitReporter{W: &buf, Name: "connectivity"}.Report(testMatrix()))
+
+	out := buf.String()
+	assert.Contains(t, out, `tests="3"`)
+	assert.Contains(t, out, `failures="1"`)
+	assert.Contains(t, out, "vpc-02-&gt;vpc-03")
+}
+
+func TestMatrixReporter(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, MatrixReporter{W: &buf}.Report(testMatrix()))
+
+	out := buf.String()
+	assert.Contains(t, out, "vpc-01")
+	assert.Contains(t, out, ".")
+	assert.Contains(t, out, "x")
+}
@@ -0,0 +1,243 @@
+// Copyright 2024 Hedgehog
+// SPDX-License-Identifier: Apache-2.0
+
+// Package topo loads declarative YAML topology descriptors for VPC/external
+// peering test scenarios and turns them into the options and peering specs
+// consumed by the hhfab VLAB pipeline.
+package topo
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	vpcapi "go.githedgehog.com/fabric/api/vpc/v1beta1"
+	"go.githedgehog.com/fabricator/pkg/hhfab"
+	"go.githedgehog.com/fabricator/pkg/hhfab/alloc"
+	"go.githedgehog.com/fabricator/pkg/hhfab/report"
+	"gopkg.in/yaml.v3"
+)
+
+// Peering describes one VPC-to-VPC peering entry in a topology file.
+//
+//	peerings:
+//	  - vpcs: [1, 2]
+//	  - vpcs: [1, 3]
+//	    remote: border
+//	    subnets: ["subnet-01", "subnet-02"]
+type Peering struct {
+	VPCs    []int    `yaml:"vpcs"`
+	Remote  string   `yaml:"remote,omitempty"`
+	Subnets []string `yaml:"subnets,omitempty"`
+}
+
+// External describes one VPC-to-external peering entry in a topology file.
+//
+//	externals:
+//	  - vpc: 5
+//	    external: default--5835
+//	    subnets: ["subnet-01"]
+type External struct {
+	VPC      int      `yaml:"vpc"`
+	External string   `yaml:"external"`
+	Subnets  []string `yaml:"subnets,omitempty"`
+	Prefixes []string `yaml:"prefixes,omitempty"`
+}
+
+// Topology is the root of a topology descriptor file.
+type Topology struct {
+	VPCs             int        `yaml:"vpcs"`
+	SubnetsPerVPC    int        `yaml:"subnets_per_vpc"`
+	ServersPerSubnet int        `yaml:"servers_per_subnet"`
+	VLANNamespace    string     `yaml:"vlan_namespace"`
+	IPv4Namespace    string     `yaml:"ipv4_namespace"`
+	Peerings         []Peering  `yaml:"peerings"`
+	Externals        []External `yaml:"externals"`
+	// Pools, if set, has each VPC's peering subnet drawn from an
+	// alloc.Allocator instead of left for the operator to spell out in
+	// Peering.Subnets - useful for large mesh topologies where listing every
+	// pair's subnets by hand doesn't scale.
+	Pools *alloc.Pools `yaml:"pools,omitempty"`
+}
+
+// vpcName returns the "vpc-NN" name topo uses for the n'th VPC (1-indexed),
+// matching the convention Peering.VPCs and External.VPC index into.
+func vpcName(n int) string {
+	return fmt.Sprintf("vpc-%02d", n)
+}
+
+// Load reads and parses a topology descriptor from path.
+func Load(path string) (*Topology, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading topology %q: %w", path, err)
+	}
+
+	topo := &Topology{
+		SubnetsPerVPC:    1,
+		ServersPerSubnet: 1,
+		VLANNamespace:    "default",
+		IPv4Namespace:    "default",
+	}
+	if err := yaml.Unmarshal(data, topo); err != nil {
+		return nil, fmt.Errorf("parsing topology %q: %w", path, err)
+	}
+
+	if topo.VPCs <= 0 {
+		return nil, fmt.Errorf("topology %q: vpcs must be > 0", path)
+	}
+
+	return topo, nil
+}
+
+// Build converts the topology into the SetupVPCsOpts and peering spec maps
+// expected by DoVLABSetupVPCs and DoSetupPeerings.
+func (t *Topology) Build() (hhfab.SetupVPCsOpts, map[string]*vpcapi.VPCPeeringSpec, map[string]*vpcapi.ExternalPeeringSpec, error) {
+	opts := hhfab.SetupVPCsOpts{
+		WaitSwitchesReady: true,
+		ServersPerSubnet:  t.ServersPerSubnet,
+		SubnetsPerVPC:     t.SubnetsPerVPC,
+		VLANNamespace:     t.VLANNamespace,
+		IPv4Namespace:     t.IPv4Namespace,
+	}
+
+	vpcPeerings := make(map[string]*vpcapi.VPCPeeringSpec, len(t.Peerings))
+	for _, p := range t.Peerings {
+		if len(p.VPCs) != 2 {
+			return opts, nil, nil, fmt.Errorf("peering %v: expected exactly 2 vpcs", p.VPCs)
+		}
+
+		vpc1 := vpcName(p.VPCs[0])
+		vpc2 := vpcName(p.VPCs[1])
+		entryName := fmt.Sprintf("%s--%s", vpc1, vpc2)
+
+		subnets := p.Subnets
+		if subnets == nil {
+			subnets = []string{}
+		}
+
+		vpcPeerings[entryName] = &vpcapi.VPCPeeringSpec{
+			Remote: p.Remote,
+			Permit: []map[string]vpcapi.VPCPeer{
+				{
+					vpc1: vpcapi.VPCPeer{Subnets: subnets},
+					vpc2: vpcapi.VPCPeer{Subnets: subnets},
+				},
+			},
+		}
+	}
+
+	extPeerings := make(map[string]*vpcapi.ExternalPeeringSpec, len(t.Externals))
+	for _, e := range t.Externals {
+		vpc := vpcName(e.VPC)
+		entryName := fmt.Sprintf("%s--%s", vpc, e.External)
+
+		prefixes := make([]vpcapi.ExternalPeeringSpecPrefix, len(e.Prefixes))
+		for i, prefix := range e.Prefixes {
+			prefixes[i] = vpcapi.ExternalPeeringSpecPrefix{Prefix: prefix}
+		}
+
+		extPeerings[entryName] = &vpcapi.ExternalPeeringSpec{
+			Permit: vpcapi.ExternalPeeringSpecPermit{
+				VPC: vpcapi.ExternalPeeringSpecVPC{
+					Name:    vpc,
+					Subnets: e.Subnets,
+				},
+				External: vpcapi.ExternalPeeringSpecExternal{
+					Name:     e.External,
+					Prefixes: prefixes,
+				},
+			},
+		}
+	}
+
+	return opts, vpcPeerings, extPeerings, nil
+}
+
+// RunTopologyTest loads the topology descriptor at path and drives the
+// existing VLAB pipeline (setup VPCs, setup peerings, test connectivity)
+// against it, so new scenarios can be added by dropping a file into
+// testdata/topologies/ without writing Go. If reporter is non-nil, the
+// connectivity phase runs through DoVLABTestConnectivityWithReporter and
+// reporter gets a per-server-pair breakdown instead of just the aggregate
+// pass/fail RunTopologyTest itself returns.
+func RunTopologyTest(ctx context.Context, workDir, cacheDir, path string, reporter report.Reporter) error {
+	t, err := Load(path)
+	if err != nil {
+		return err
+	}
+
+	opts, vpcPeerings, extPeerings, err := t.Build()
+	if err != nil {
+		return fmt.Errorf("building topology %q: %w", path, err)
+	}
+
+	vpcNames := make([]string, t.VPCs)
+	for i := range vpcNames {
+		vpcNames[i] = vpcName(i + 1)
+	}
+
+	if t.Pools != nil {
+		a, err := alloc.New(*t.Pools)
+		if err != nil {
+			return fmt.Errorf("building allocator for topology %q: %w", path, err)
+		}
+
+		subnets, err := hhfab.DoVLABSetupVPCsWithAllocator(ctx, workDir, cacheDir, opts, vpcNames, a, os.Stdout)
+		if err != nil {
+			return fmt.Errorf("setting up vpcs: %w", err)
+		}
+
+		applyAllocatedSubnets(vpcPeerings, subnets)
+	} else if err := hhfab.DoVLABSetupVPCs(ctx, workDir, cacheDir, opts); err != nil {
+		return fmt.Errorf("setting up vpcs: %w", err)
+	}
+
+	kube, err := hhfab.GetKubeClient(ctx, workDir)
+	if err != nil {
+		return fmt.Errorf("getting kube client: %w", err)
+	}
+
+	if err := hhfab.DoSetupPeerings(ctx, kube, vpcPeerings, extPeerings, true); err != nil {
+		return fmt.Errorf("setting up peerings: %w", err)
+	}
+
+	connOpts := hhfab.TestConnectivityOpts{WaitSwitchesReady: true}
+
+	if reporter == nil {
+		if err := hhfab.DoVLABTestConnectivity(ctx, workDir, cacheDir, connOpts); err != nil {
+			return fmt.Errorf("testing connectivity: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := hhfab.DoVLABTestConnectivityWithReporter(
+		ctx, workDir, cacheDir, connOpts, vpcNames, t.SubnetsPerVPC, t.ServersPerSubnet,
+		vpcPeerings, extPeerings, reporter,
+	); err != nil {
+		return fmt.Errorf("testing connectivity: %w", err)
+	}
+
+	return nil
+}
+
+// applyAllocatedSubnets fills in a peering's permit subnets from subnets
+// for any VPC side that didn't specify them explicitly in the topology
+// file, so a Pools-driven topology doesn't need every pair's subnets
+// spelled out by hand.
+func applyAllocatedSubnets(vpcPeerings map[string]*vpcapi.VPCPeeringSpec, subnets map[string]alloc.Subnet) {
+	for _, spec := range vpcPeerings {
+		for _, permit := range spec.Permit {
+			for vpc, peer := range permit {
+				if len(peer.Subnets) > 0 {
+					continue
+				}
+				if s, ok := subnets[vpc]; ok {
+					peer.Subnets = []string{s.CIDR}
+					permit[vpc] = peer
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 Hedgehog
+// SPDX-License-Identifier: Apache-2.0
+
+package topo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.githedgehog.com/fabricator/pkg/hhfab/alloc"
+)
+
+func TestLoadStarter(t *testing.T) {
+	topo, err := Load("../testdata/topologies/starter.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, 6, topo.VPCs)
+	assert.Len(t, topo.Peerings, 6)
+	assert.Len(t, topo.Externals, 4)
+
+	opts, vpcPeerings, extPeerings, err := topo.Build()
+	require.NoError(t, err)
+	assert.Equal(t, "default", opts.VLANNamespace)
+	assert.Len(t, vpcPeerings, 6)
+	assert.Len(t, extPeerings, 4)
+
+	peering, ok := vpcPeerings["vpc-01--vpc-02"]
+	require.True(t, ok)
+	assert.Len(t, peering.Permit, 1)
+
+	ext, ok := extPeerings["vpc-05--default--5835"]
+	require.True(t, ok)
+	assert.Equal(t, "vpc-05", ext.Permit.VPC.Name)
+	assert.Equal(t, []string{"subnet-01"}, ext.Permit.VPC.Subnets)
+}
+
+func TestLoadFullMeshPlusExternal(t *testing.T) {
+	topo, err := Load("../testdata/topologies/full-mesh-plus-external.yaml")
+	require.NoError(t, err)
+
+	_, vpcPeerings, extPeerings, err := topo.Build()
+	require.NoError(t, err)
+	assert.Len(t, vpcPeerings, 15)
+	assert.Len(t, extPeerings, 2)
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	_, err := Load("../testdata/topologies/does-not-exist.yaml")
+	assert.Error(t, err)
+}
+
+func TestBuildRejectsBadPeering(t *testing.T) {
+	topo := &Topology{
+		VPCs:     2,
+		Peerings: []Peering{{VPCs: []int{1}}},
+	}
+	_, _, _, err := topo.Build()
+	assert.Error(t, err)
+}
+
+func TestApplyAllocatedSubnetsFillsOnlyMissing(t *testing.T) {
+	_, vpcPeerings, _, err := (&Topology{
+		VPCs: 2,
+		Peerings: []Peering{
+			{VPCs: []int{1, 2}},
+			{VPCs: []int{1, 3}, Subnets: []string{"subnet-01"}},
+		},
+	}).Build()
+	require.NoError(t, err)
+
+	subnets := map[string]alloc.Subnet{
+		"vpc-01": {CIDR: "10.0.0.0/24"},
+		"vpc-02": {CIDR: "10.0.1.0/24"},
+	}
+	applyAllocatedSubnets(vpcPeerings, subnets)
+
+	permit := vpcPeerings["vpc-01--vpc-02"].Permit[0]
+	assert.Equal(t, []string{"10.0.0.0/24"}, permit["vpc-01"].Subnets)
+	assert.Equal(t, []string{"10.0.1.0/24"}, permit["vpc-02"].Subnets)
+
+	// Explicitly listed subnets are left as they are.
+	explicit := vpcPeerings["vpc-01--vpc-03"].Permit[0]
+	assert.Equal(t, []string{"subnet-01"}, explicit["vpc-01"].Subnets)
+}
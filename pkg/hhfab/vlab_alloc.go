@@ -0,0 +1,45 @@
+// Copyright 2024 Hedgehog
+// SPDX-License-Identifier: Apache-2.0
+
+package hhfab
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"go.githedgehog.com/fabricator/pkg/hhfab/alloc"
+)
+
+// DoVLABSetupVPCsWithAllocator allocates a subnet/VLAN/VNI for each name in
+// vpcNames from a, optionally prints the resulting plan to planOut for
+// review, and then runs the regular VLAB VPC setup. Allocation happens
+// before setup so a reviewer can see exactly what a large mesh topology is
+// about to claim before anything is applied to the cluster.
+//
+// SetupVPCsOpts has no field for per-VPC addressing, so the allocation
+// can't be threaded into DoVLABSetupVPCs itself - the returned Subnets are
+// for the caller to feed into whatever it builds on top of the VPCs (e.g.
+// assigning peering subnets), which is how topo.RunTopologyTest uses it.
+func DoVLABSetupVPCsWithAllocator(ctx context.Context, workDir, cacheDir string, opts SetupVPCsOpts, vpcNames []string, a *alloc.Allocator, planOut io.Writer) (map[string]alloc.Subnet, error) {
+	subnets := make(map[string]alloc.Subnet, len(vpcNames))
+	for _, name := range vpcNames {
+		s, err := a.Allocate(name)
+		if err != nil {
+			return nil, fmt.Errorf("allocating subnet for %q: %w", name, err)
+		}
+		subnets[name] = s
+	}
+
+	if planOut != nil {
+		if err := a.PrintPlan(planOut); err != nil {
+			return nil, fmt.Errorf("printing allocation plan: %w", err)
+		}
+	}
+
+	if err := DoVLABSetupVPCs(ctx, workDir, cacheDir, opts); err != nil {
+		return nil, err
+	}
+
+	return subnets, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 Hedgehog
+// SPDX-License-Identifier: Apache-2.0
+
+package hhfabtest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// Factory constructs a fresh instance of a registered suite; New calls it.
+// `hhfab test run` does not: it runs the suite's registered test function
+// through `go test`.
+type Factory func() suite.TestingSuite
+
+// entry pairs a suite's Factory with the name of the `go test`-discoverable
+// function that runs it (e.g. "TestVPCPeeringsSuite"), so a caller driving
+// the suite via `go test -run` can target the right function instead of
+// guessing it from the registered name.
+type entry struct {
+	factory  Factory
+	testFunc string
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]entry{}
+)
+
+// Register makes a suite runnable by name via `hhfab test run --suite=name`.
+// testFunc is the name of the top-level `func TestXxx(t *testing.T)` that
+// calls suite.Run for this suite - it's what `go test -run` actually needs
+// to target, and there's no way to derive it from name alone. Suites
+// typically call this from an init() function.
+func Register(name, testFunc string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registry[name] = entry{factory: factory, testFunc: testFunc}
+}
+
+// Lookup returns the factory registered under name, if any.
+func Lookup(name string) (Factory, bool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	e, ok := registry[name]
+
+	return e.factory, ok
+}
+
+// TestFunc returns the `go test`-discoverable function name registered for
+// name, if any.
+func TestFunc(name string) (string, bool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	e, ok := registry[name]
+
+	return e.testFunc, ok
+}
+
+// Names returns the names of all registered suites, sorted.
+func Names() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// New constructs the named suite, returning an error that lists the known
+// suite names if name isn't registered.
+func New(name string) (suite.TestingSuite, error) {
+	factory, ok := Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown suite %q, known suites: %v", name, Names())
+	}
+
+	return factory(), nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 Hedgehog
+// SPDX-License-Identifier: Apache-2.0
+
+// Package hhfabtest factors out the boilerplate every VLAB-backed testify
+// suite in hhfab otherwise duplicates: resolving the work/cache dirs,
+// bringing up the kube client, and the 10-minute suite-wide context.
+package hhfabtest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	vpcapi "go.githedgehog.com/fabric/api/vpc/v1beta1"
+	"go.githedgehog.com/fabric/pkg/hhfctl"
+	"go.githedgehog.com/fabricator/pkg/hhfab"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const suiteTimeout = 10 * time.Minute
+
+// BaseSuite is embedded by hhfab testify suites to pick up the common VLAB
+// setup: a suite-wide context, a kube client, resolved work/cache dirs, and
+// the VPC setup / connectivity options most suites start from. testify
+// finds BaseSuite's SetupSuite/TearDownSuite through method promotion, so
+// they run automatically only while the embedding suite does not define
+// methods of the same name; a suite's own SetupSuite replaces BaseSuite's.
+type BaseSuite struct {
+	suite.Suite
+
+	Ctx       context.Context
+	CtxCancel context.CancelFunc
+	Kube      client.Client
+	WorkDir   string
+	CacheDir  string
+	Opts      hhfab.SetupVPCsOpts
+	TCOpts    hhfab.TestConnectivityOpts
+
+	// WipeBetweenTests wipes existing VPCs before each test. It defaults to
+	// true; see the FIXME in WipeAndSetupVPCs.
+	WipeBetweenTests bool
+}
+
+// SetupSuite resolves the work/cache dirs, brings up the kube client, and
+// applies the suite's default options.
+func (b *BaseSuite) SetupSuite() {
+	var err error
+
+	b.WorkDir, b.CacheDir, err = getEnvVars()
+	b.Require().NoError(err)
+
+	b.Ctx, b.CtxCancel = context.WithTimeout(context.Background(), suiteTimeout)
+
+	b.Kube, err = hhfab.GetKubeClient(b.Ctx, b.WorkDir)
+	b.Require().NoError(err)
+
+	b.WipeBetweenTests = true
+	b.Opts = hhfab.SetupVPCsOpts{
+		WaitSwitchesReady: true,
+		ServersPerSubnet:  1,
+		SubnetsPerVPC:     1,
+		VLANNamespace:     "default",
+		IPv4Namespace:     "default",
+	}
+	b.TCOpts = hhfab.TestConnectivityOpts{
+		WaitSwitchesReady: true,
+	}
+}
+
+// TearDownSuite releases the suite-wide context.
+func (b *BaseSuite) TearDownSuite() {
+	if b.CtxCancel != nil {
+		b.CtxCancel()
+	}
+}
+
+// WipeAndSetupVPCs wipes existing VPCs (if WipeBetweenTests is set) and
+// brings up fresh ones using b.Opts, failing the current test on error.
+func (b *BaseSuite) WipeAndSetupVPCs() {
+	// FIXME: Remove the wipe once the gnmi issue is fixed.
+	if b.WipeBetweenTests {
+		if err := hhfctl.VPCWipe(b.Ctx); err != nil {
+			b.T().Fatalf("VPCWipe: %v", err)
+		}
+	}
+
+	if err := hhfab.DoVLABSetupVPCs(b.Ctx, b.WorkDir, b.CacheDir, b.Opts); err != nil {
+		b.T().Fatalf("DoVLABSetupVPCs: %v", err)
+	}
+}
+
+// SetupPeeringsAndTest applies the given peerings and runs the connectivity
+// test against them, failing the current test on error.
+func (b *BaseSuite) SetupPeeringsAndTest(vpcPeerings map[string]*vpcapi.VPCPeeringSpec, extPeerings map[string]*vpcapi.ExternalPeeringSpec) {
+	if err := hhfab.DoSetupPeerings(b.Ctx, b.Kube, vpcPeerings, extPeerings, true); err != nil {
+		b.T().Fatalf("DoSetupPeerings: %v", err)
+	}
+	if err := hhfab.DoVLABTestConnectivity(b.Ctx, b.WorkDir, b.CacheDir, b.TCOpts); err != nil {
+		b.T().Fatalf("DoVLABTestConnectivity: %v", err)
+	}
+}
+
+func getEnvVars() (workDir, cacheDir string, err error) {
+	workDir = os.Getenv("HHFAB_WORK_DIR")
+	cacheDir = os.Getenv("HHFAB_CACHE_DIR")
+
+	if workDir == "" || cacheDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", err
+		}
+		if workDir == "" {
+			workDir = filepath.Join(home, "hhfab")
+		}
+		if cacheDir == "" {
+			cacheDir = filepath.Join(home, ".hhfab-cache")
+		}
+	}
+
+	return workDir, cacheDir, nil
+}
@@ -9,6 +9,7 @@ import (
 
 	"go.githedgehog.com/fabric/pkg/util/kubeutil"
 	fabapi "go.githedgehog.com/fabricator/api/fabricator/v1beta1"
+	"go.githedgehog.com/fabricator/pkg/hhfab/report"
 )
 
 func PrintFab(f fabapi.Fabricator, controls []fabapi.ControlNode, w io.Writer) error {
@@ -29,3 +30,27 @@ func PrintFab(f fabapi.Fabricator, controls []fabapi.ControlNode, w io.Writer) e
 
 	return nil
 }
+
+// PrintConnectivityReport renders a connectivity matrix in the given
+// format ("json", "junit", or "matrix") to w, so CI can archive the report
+// alongside the fabricator YAML dump printed by PrintFab.
+func PrintConnectivityReport(matrix report.Matrix, w io.Writer, format string) error {
+	var reporter report.Reporter
+
+	switch format {
+	case "json":
+		reporter = report.JSONReporter{W: w}
+	case "junit":
+		reporter = report.JUnitReporter{W: w}
+	case "matrix":
+		reporter = report.MatrixReporter{W: w}
+	default:
+		return fmt.Errorf("unknown connectivity report format %q", format)
+	}
+
+	if err := reporter.Report(matrix); err != nil {
+		return fmt.Errorf("printing connectivity report: %w", err)
+	}
+
+	return nil
+}